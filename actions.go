@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	actionSilence1h   = "silence_1h"
+	actionAcknowledge = "acknowledge"
+
+	ackSilenceDuration = 15 * time.Minute
+)
+
+// signCardActionValue signs an alert fingerprint/action/expiry/labels
+// tuple so it can ride in a card button's "value" payload and be trusted
+// when it comes back through the callback endpoint.
+func signCardActionValue(fingerprint, action string, expiry int64, labels string, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(fmt.Sprintf("%s|%s|%d|%s", fingerprint, action, expiry, labels)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyCardActionValue reports whether sig is the expected signature for
+// the given fields and the action has not expired.
+func verifyCardActionValue(fingerprint, action string, expiry int64, labels, sig, secret string) error {
+	if time.Now().Unix() > expiry {
+		return fmt.Errorf("action token expired")
+	}
+	expected := signCardActionValue(fingerprint, action, expiry, labels, secret)
+	expectedBytes, err := hex.DecodeString(expected)
+	if err != nil {
+		return err
+	}
+	gotBytes, err := hex.DecodeString(sig)
+	if err != nil {
+		return fmt.Errorf("malformed signature: %w", err)
+	}
+	if !hmac.Equal(expectedBytes, gotBytes) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+// encodeActionLabels JSON-encodes a label set for the signed button
+// value, so the callback has enough context to build Alertmanager
+// silence matchers without server-side state. JSON (rather than a
+// delimited "k=v,k2=v2" string) avoids mis-splitting label values that
+// legally contain "," or "=".
+func encodeActionLabels(labels map[string]string) string {
+	encoded, err := json.Marshal(labels)
+	if err != nil {
+		return ""
+	}
+	return string(encoded)
+}
+
+func decodeActionLabels(encoded string) map[string]string {
+	labels := make(map[string]string)
+	if encoded == "" {
+		return labels
+	}
+	if err := json.Unmarshal([]byte(encoded), &labels); err != nil {
+		log.Printf("Malformed card action labels %q: %v", encoded, err)
+	}
+	return labels
+}
+
+// buildAlertActionsElement renders the Silence/Acknowledge/Runbook button
+// row for an alert card. Silence and Acknowledge values are HMAC-signed so
+// the callback endpoint can trust them without server-side state;
+// Runbook is a plain link and needs no signature. runbookURL is omitted
+// from the row entirely when the alert carries none.
+func buildAlertActionsElement(fingerprint string, labels map[string]string, runbookURL, secret string, ttl time.Duration) FeishuCardActionElement {
+	encodedLabels := encodeActionLabels(labels)
+	expiry := time.Now().Add(ttl).Unix()
+
+	buttonValue := func(action string) map[string]string {
+		return map[string]string{
+			"fingerprint": fingerprint,
+			"action":      action,
+			"expiry":      strconv.FormatInt(expiry, 10),
+			"labels":      encodedLabels,
+			"sig":         signCardActionValue(fingerprint, action, expiry, encodedLabels, secret),
+		}
+	}
+
+	buttons := []FeishuCardButton{
+		{
+			Tag:   "button",
+			Text:  FeishuCardTextElement{Tag: "plain_text", Content: "Silence 1h"},
+			Type:  "default",
+			Value: buttonValue(actionSilence1h),
+		},
+		{
+			Tag:   "button",
+			Text:  FeishuCardTextElement{Tag: "plain_text", Content: "Acknowledge"},
+			Type:  "default",
+			Value: buttonValue(actionAcknowledge),
+		},
+	}
+	if runbookURL != "" {
+		buttons = append(buttons, FeishuCardButton{
+			Tag:  "button",
+			Text: FeishuCardTextElement{Tag: "plain_text", Content: "Open Runbook"},
+			Type: "default",
+			URL:  runbookURL,
+		})
+	}
+
+	return FeishuCardActionElement{Tag: "action", Actions: buttons}
+}
+
+// verifyLarkCallbackSignature checks Feishu's card-callback signature: hex(HMAC-SHA256(timestamp+nonce+body, key=encryptKey)).
+func verifyLarkCallbackSignature(timestamp, nonce string, body []byte, sig, encryptKey string) error {
+	mac := hmac.New(sha256.New, []byte(encryptKey))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte(nonce))
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(sig)) {
+		return fmt.Errorf("lark callback signature mismatch")
+	}
+	return nil
+}
+
+type feishuCardActionRequest struct {
+	Token  string `json:"token"`
+	Action struct {
+		Value map[string]string `json:"value"`
+	} `json:"action"`
+}
+
+type feishuCardActionResponse struct {
+	Toast feishuToast         `json:"toast"`
+	Card  *feishuCallbackCard `json:"card,omitempty"`
+}
+
+// feishuCallbackCard is Feishu's envelope for replacing a card's content
+// from a button-click callback response; Data uses the same shape
+// Deliver builds for a freshly sent card.
+type feishuCallbackCard struct {
+	Type string            `json:"type"`
+	Data FeishuCardContent `json:"data"`
+}
+
+type feishuToast struct {
+	Type    string `json:"type"`
+	Content string `json:"content"`
+}
+
+// buildActionResultCard renders the small replacement card returned
+// alongside the toast on a successful Silence/Acknowledge click, so the
+// user sees the outcome instead of a card whose buttons still look
+// clickable/un-acted-on.
+func buildActionResultCard(labels map[string]string, comment string, until time.Time) FeishuCardContent {
+	title := labels["alertname"]
+	if title == "" {
+		title = "Alert"
+	}
+	return FeishuCardContent{
+		Header: FeishuCardHeader{
+			Title:    FeishuCardTextElement{Tag: "plain_text", Content: title},
+			Template: "blue",
+		},
+		Elements: []interface{}{
+			FeishuCardDivElement{
+				Tag: "div",
+				Text: FeishuCardTextElement{
+					Tag:     "lark_md",
+					Content: fmt.Sprintf("%s，至 %s", comment, until.Format("15:04")),
+				},
+			},
+		},
+	}
+}
+
+// createAlertmanagerSilence creates a silence matching labels, valid for
+// duration, via Alertmanager's v2 silence API.
+func createAlertmanagerSilence(alertmanagerURL string, labels map[string]string, duration time.Duration, comment string) error {
+	matchers := make([]map[string]interface{}, 0, len(labels))
+	for name, value := range labels {
+		matchers = append(matchers, map[string]interface{}{
+			"name":    name,
+			"value":   value,
+			"isRegex": false,
+		})
+	}
+
+	now := time.Now().UTC()
+	payload, err := json.Marshal(map[string]interface{}{
+		"matchers":  matchers,
+		"startsAt":  now.Format(time.RFC3339),
+		"endsAt":    now.Add(duration).Format(time.RFC3339),
+		"createdBy": "grafana-feishu",
+		"comment":   comment,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", strings.TrimRight(alertmanagerURL, "/")+"/api/v2/silences", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("alertmanager returned %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// registerFeishuCallback wires up POST /feishu/callback, which handles
+// card button clicks for the Silence/Acknowledge actions.
+func registerFeishuCallback(app *fiber.App, encryptKey, actionSecret, alertmanagerURL string) {
+	app.Post("/feishu/callback", func(c *fiber.Ctx) error {
+		body := c.Body()
+
+		if encryptKey != "" {
+			timestamp := string(c.Request().Header.Peek("X-Lark-Request-Timestamp"))
+			nonce := string(c.Request().Header.Peek("X-Lark-Request-Nonce"))
+			sig := string(c.Request().Header.Peek("X-Lark-Signature"))
+			if err := verifyLarkCallbackSignature(timestamp, nonce, body, sig, encryptKey); err != nil {
+				log.Printf("Rejecting Feishu callback: %v", err)
+				return c.SendStatus(fiber.StatusUnauthorized)
+			}
+		}
+
+		var payload feishuCardActionRequest
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return err
+		}
+
+		value := payload.Action.Value
+		fingerprint := value["fingerprint"]
+		action := value["action"]
+		expiry, _ := strconv.ParseInt(value["expiry"], 10, 64)
+		if err := verifyCardActionValue(fingerprint, action, expiry, value["labels"], value["sig"], actionSecret); err != nil {
+			log.Printf("Rejecting card action: %v", err)
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+
+		labels := decodeActionLabels(value["labels"])
+
+		var (
+			duration time.Duration
+			comment  string
+		)
+		switch action {
+		case actionSilence1h:
+			duration = time.Hour
+			comment = "Silenced for 1h via Feishu card"
+		case actionAcknowledge:
+			duration = ackSilenceDuration
+			comment = "Acknowledged via Feishu card"
+		default:
+			return c.Status(fiber.StatusBadRequest).JSON(feishuCardActionResponse{
+				Toast: feishuToast{Type: "error", Content: "Unknown action: " + action},
+			})
+		}
+
+		if err := createAlertmanagerSilence(alertmanagerURL, labels, duration, comment); err != nil {
+			log.Printf("Failed to create Alertmanager silence: %v", err)
+			return c.JSON(feishuCardActionResponse{
+				Toast: feishuToast{Type: "error", Content: "Failed to silence alert: " + err.Error()},
+			})
+		}
+
+		until := time.Now().Add(duration)
+		return c.JSON(feishuCardActionResponse{
+			Toast: feishuToast{Type: "success", Content: comment},
+			Card:  &feishuCallbackCard{Type: "raw", Data: buildActionResultCard(labels, comment, until)},
+		})
+	})
+}
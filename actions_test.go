@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignAndVerifyCardActionValue(t *testing.T) {
+	secret := "sign-secret"
+	labels := encodeActionLabels(map[string]string{"alertname": "HighCPU", "instance": "host-1"})
+	fingerprint := "abc123"
+	action := actionSilence1h
+
+	futureExpiry := time.Now().Add(time.Hour).Unix()
+	pastExpiry := time.Now().Add(-time.Hour).Unix()
+	validSig := signCardActionValue(fingerprint, action, futureExpiry, labels, secret)
+
+	cases := []struct {
+		name    string
+		sig     string
+		expiry  int64
+		secret  string
+		wantErr bool
+	}{
+		{"matching signature", validSig, futureExpiry, secret, false},
+		{"mismatched signature (wrong secret)", validSig, futureExpiry, "other-secret", true},
+		{"tampered signature bytes", validSig[:len(validSig)-2] + "00", futureExpiry, secret, true},
+		{"expired token", signCardActionValue(fingerprint, action, pastExpiry, labels, secret), pastExpiry, secret, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := verifyCardActionValue(fingerprint, action, tc.expiry, labels, tc.sig, tc.secret)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("verifyCardActionValue() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestEncodeDecodeActionLabels(t *testing.T) {
+	labels := map[string]string{
+		"alertname": "HighCPU",
+		// legal Prometheus label value containing "," and "=", which a
+		// delimited "k=v,k2=v2" encoding would mis-split.
+		"instance": "host=a,zone=us-east",
+	}
+
+	decoded := decodeActionLabels(encodeActionLabels(labels))
+	for k, v := range labels {
+		if decoded[k] != v {
+			t.Errorf("decodeActionLabels()[%q] = %q, want %q", k, decoded[k], v)
+		}
+	}
+}
+
+func TestVerifyLarkCallbackSignature(t *testing.T) {
+	encryptKey := "callback-key"
+	timestamp := "1700000000"
+	nonce := "nonce-1"
+	body := []byte(`{"token":"t"}`)
+
+	mac := hmac.New(sha256.New, []byte(encryptKey))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte(nonce))
+	mac.Write(body)
+	validSig := hex.EncodeToString(mac.Sum(nil))
+
+	cases := []struct {
+		name    string
+		sig     string
+		wantErr bool
+	}{
+		{"matching signature", validSig, false},
+		{"mismatched signature", strings.Repeat("0", len(validSig)), true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := verifyLarkCallbackSignature(timestamp, nonce, body, tc.sig, encryptKey)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("verifyLarkCallbackSignature() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+// Package dedup coalesces repeat alert firings into a single tracked
+// message instead of spamming a new one per evaluation cycle, and drops
+// resolved notifications that have no stored firing counterpart (never
+// seen, or already closed by an earlier resolve). Stored state is not
+// expired by the window; it is removed only when a resolve closes it.
+package dedup
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+var bucketName = []byte("groups")
+
+// State is what's persisted per group+fingerprint so the bridge can
+// patch the same Feishu message across repeat firings and know whether
+// a resolved notification still has an open firing counterpart.
+type State struct {
+	MessageID  string    `json:"message_id"`
+	ReceiverID string    `json:"receiver_id"`
+	LastFiring time.Time `json:"last_firing"`
+}
+
+// Store persists group state in a local bbolt file so restarts don't
+// lose dedup context.
+type Store struct {
+	db     *bbolt.DB
+	window time.Duration
+}
+
+// NewStore opens (creating if needed) a bbolt file at path. window is
+// how long a repeat firing is considered part of the same group.
+func NewStore(path string, window time.Duration) (*Store, error) {
+	db, err := bbolt.Open(path, 0o600, nil)
+	if err != nil {
+		return nil, fmt.Errorf("open dedup store %s: %w", path, err)
+	}
+	if err := db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketName)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db, window: window}, nil
+}
+
+// Close releases the underlying bbolt file.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Key builds the groupKey+fingerprint dedup key.
+func Key(groupKey, fingerprint string) string {
+	return groupKey + "|" + fingerprint
+}
+
+// Get returns the state for key, if any.
+func (s *Store) Get(key string) (State, bool, error) {
+	var state State
+	found := false
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		raw := tx.Bucket(bucketName).Get([]byte(key))
+		if raw == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(raw, &state)
+	})
+	return state, found, err
+}
+
+// WithinWindow reports whether state's last firing is still within the
+// coalescing window, i.e. a repeat firing should update it in place
+// rather than send a new message.
+func (s *Store) WithinWindow(state State) bool {
+	return s.window > 0 && time.Since(state.LastFiring) < s.window
+}
+
+// Put stores state for key.
+func (s *Store) Put(key string, state State) error {
+	raw, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketName).Put([]byte(key), raw)
+	})
+}
+
+// Delete removes key, e.g. once a resolved notification has closed the group.
+func (s *Store) Delete(key string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketName).Delete([]byte(key))
+	})
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/highkay/grafana-feishu/dedup"
+	"github.com/highkay/grafana-feishu/diagram"
+	"github.com/highkay/grafana-feishu/feishu"
+	"github.com/highkay/grafana-feishu/routing"
+	"github.com/highkay/grafana-feishu/runbook"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// deliverer owns everything needed to turn a parsed Notification into a
+// Feishu card and get it to the right place: optional per-alert routing
+// and templating, AI/runbook enrichment, and dedup-aware send/patch.
+type deliverer struct {
+	dispatcher           *feishuDispatcher
+	appClient            *feishu.Client
+	defaultReceiveIDType string
+
+	openaiClient               *openai.Client
+	openaiModelName            string
+	runbookStore               runbook.Store
+	runbookMaxSnippets         int
+	runbookSimilarityThreshold float64
+
+	cardActionSecret string
+
+	routingConfig *routing.Config
+	dedupStore    *dedup.Store
+
+	diagramPipeline *diagram.Pipeline
+}
+
+// sendTarget names where a card should go, independent of how it got
+// there (route receiver lookup vs. the legacy env-configured default).
+type sendTarget struct {
+	appMode          bool
+	appReceiveID     string
+	appReceiveIDType string
+	botUUID          string
+}
+
+func (d *deliverer) sendNew(ctx context.Context, target sendTarget, card *FeishuCard) (string, error) {
+	if target.appMode {
+		return d.appClient.SendInteractive(ctx, target.appReceiveID, target.appReceiveIDType, card.Card)
+	}
+	return "", d.dispatcher.Send(target.botUUID, card)
+}
+
+func (d *deliverer) patchExisting(ctx context.Context, messageID string, card *FeishuCard) error {
+	if d.appClient == nil {
+		return fmt.Errorf("patching a message requires app mode")
+	}
+	return d.appClient.PatchInteractive(ctx, messageID, card.Card)
+}
+
+// resolveTarget picks where to send: a matched route's receiver takes
+// precedence, then the legacy feishu_chat_id label / default bot UUID
+// behavior from before routing existed.
+func (d *deliverer) resolveTarget(notification *Notification, pathBotUUID string, route routing.Route, hasRoute bool) sendTarget {
+	if hasRoute && route.Receiver != "" {
+		if recv, ok := d.routingConfig.ReceiverByName(route.Receiver); ok {
+			if recv.ChatID != "" && d.appClient != nil {
+				return sendTarget{appMode: true, appReceiveID: recv.ChatID, appReceiveIDType: d.defaultReceiveIDType}
+			}
+			if recv.BotUUID != "" {
+				return sendTarget{botUUID: recv.BotUUID}
+			}
+		}
+		log.Printf("Route receiver %q not resolvable, falling back to default delivery", route.Receiver)
+	}
+
+	if d.appClient != nil {
+		if receiveID, ok := notification.CommonLabels["feishu_chat_id"]; ok && receiveID != "" {
+			return sendTarget{appMode: true, appReceiveID: receiveID, appReceiveIDType: d.defaultReceiveIDType}
+		}
+	}
+	return sendTarget{botUUID: pathBotUUID}
+}
+
+// Deliver renders and sends (or patches/dedups) a single notification.
+func (d *deliverer) Deliver(ctx context.Context, pathBotUUID string, notification *Notification) error {
+	var route routing.Route
+	hasRoute := false
+	if d.routingConfig != nil {
+		route, hasRoute = d.routingConfig.Match(notification.CommonLabels)
+	}
+
+	title, description := d.renderContent(notification, route, hasRoute)
+	color := d.resolveColor(notification, route, hasRoute)
+	enrichAI := !hasRoute || route.EnrichAI()
+
+	var runbookTitles []string
+	if enrichAI {
+		description, runbookTitles = d.enrich(ctx, notification, description)
+	}
+
+	elements := []interface{}{
+		FeishuCardDivElement{
+			Tag: "div",
+			Text: FeishuCardTextElement{
+				Tag:     "lark_md",
+				Content: description,
+			},
+		},
+	}
+	if hasRoute && len(route.Mentions) > 0 {
+		elements = append(elements, FeishuCardNoteElement{
+			Tag: "note",
+			Elements: []FeishuCardTextElement{
+				{Tag: "lark_md", Content: "cc " + strings.Join(route.Mentions, ", ")},
+			},
+		})
+	}
+	if len(runbookTitles) > 0 {
+		elements = append(elements, FeishuCardNoteElement{
+			Tag: "note",
+			Elements: []FeishuCardTextElement{
+				{Tag: "lark_md", Content: "参考 Runbook: " + strings.Join(runbookTitles, ", ")},
+			},
+		})
+	}
+	if enrichAI && len(notification.Alerts) > 0 {
+		if imgKey := d.diagramImage(ctx, notification.Alerts[0], description); imgKey != "" {
+			elements = append(elements, FeishuCardImgElement{
+				Tag:    "img",
+				ImgKey: imgKey,
+				Alt:    FeishuCardTextElement{Tag: "plain_text", Content: "故障诊断图"},
+			})
+		}
+	}
+	if d.cardActionSecret != "" && notification.Status == "firing" && len(notification.Alerts) > 0 {
+		alert := notification.Alerts[0]
+		elements = append(elements, buildAlertActionsElement(alert.Fingerprint, alert.Labels, alert.Annotations["runbook_url"], d.cardActionSecret, cardActionTTL))
+	}
+
+	card := &FeishuCard{
+		MsgType: "interactive",
+		Card: FeishuCardContent{
+			Header: FeishuCardHeader{
+				Title:    FeishuCardTextElement{Tag: "plain_text", Content: title},
+				Template: color,
+			},
+			Elements: elements,
+		},
+	}
+
+	target := d.resolveTarget(notification, pathBotUUID, route, hasRoute)
+	return d.send(ctx, target, notification, card)
+}
+
+// send delivers card to target, coalescing repeat firings and dropping
+// orphaned resolves when a dedup store is configured.
+func (d *deliverer) send(ctx context.Context, target sendTarget, notification *Notification, card *FeishuCard) error {
+	if d.dedupStore == nil || len(notification.Alerts) == 0 {
+		_, err := d.sendNew(ctx, target, card)
+		return err
+	}
+
+	key := dedup.Key(notification.GroupKey, notification.Alerts[0].Fingerprint)
+	state, found, err := d.dedupStore.Get(key)
+	if err != nil {
+		log.Printf("Dedup lookup failed for %s: %v", key, err)
+	}
+
+	if notification.Status == "resolved" {
+		if !found {
+			log.Printf("Dropping resolved notification %s: firing counterpart already closed", key)
+			return nil
+		}
+		if state.MessageID != "" && target.appMode {
+			if err := d.patchExisting(ctx, state.MessageID, card); err != nil {
+				return err
+			}
+		} else if _, err := d.sendNew(ctx, target, card); err != nil {
+			return err
+		}
+		return d.dedupStore.Delete(key)
+	}
+
+	if found && d.dedupStore.WithinWindow(state) {
+		if state.MessageID != "" && target.appMode {
+			if err := d.patchExisting(ctx, state.MessageID, card); err != nil {
+				return err
+			}
+		} else {
+			log.Printf("Repeat firing %s within dedup window but no patchable message; skipping to avoid spam", key)
+		}
+		state.LastFiring = time.Now()
+		return d.dedupStore.Put(key, state)
+	}
+
+	messageID, err := d.sendNew(ctx, target, card)
+	if err != nil {
+		return err
+	}
+	return d.dedupStore.Put(key, dedup.State{MessageID: messageID, LastFiring: time.Now()})
+}
+
+// renderContent applies the matched route's templates, falling back to
+// the original CommonAnnotations-based behavior when no route matched or
+// a template wasn't configured.
+func (d *deliverer) renderContent(notification *Notification, route routing.Route, hasRoute bool) (title, description string) {
+	title, ok := notification.CommonAnnotations["summary"]
+	if !ok {
+		title = notification.Title
+	}
+	description, ok = notification.CommonAnnotations["description"]
+	if !ok {
+		description = notification.Message
+	}
+
+	if !hasRoute {
+		return title, description
+	}
+
+	data := routing.AlertData{
+		Status:            notification.Status,
+		CommonLabels:      notification.CommonLabels,
+		CommonAnnotations: notification.CommonAnnotations,
+		ExternalURL:       notification.ExternalURL,
+		Mentions:          route.Mentions,
+	}
+	if len(notification.Alerts) > 0 {
+		alert := notification.Alerts[0]
+		data.Labels = alert.Labels
+		data.Annotations = alert.Annotations
+		data.StartsAt = alert.StartsAt
+		data.EndsAt = alert.EndsAt
+		data.GeneratorURL = alert.GeneratorURL
+	}
+
+	if route.TitleTemplate != "" {
+		if rendered, err := routing.Render(route.TitleTemplate, data); err != nil {
+			log.Printf("Render title_template failed: %v", err)
+		} else {
+			title = rendered
+		}
+	}
+	if route.BodyTemplate != "" {
+		if rendered, err := routing.Render(route.BodyTemplate, data); err != nil {
+			log.Printf("Render body_template failed: %v", err)
+		} else {
+			description = rendered
+		}
+	}
+	return title, description
+}
+
+func (d *deliverer) resolveColor(notification *Notification, route routing.Route, hasRoute bool) string {
+	if hasRoute {
+		if color, ok := route.Colors[notification.Status]; ok {
+			return color
+		}
+	}
+	if notification.Status == "resolved" {
+		return "green"
+	}
+	return "red"
+}
+
+// enrich calls OpenAI with the runbook-augmented prompt, returning the
+// (possibly unchanged) description and the titles of any runbooks used.
+func (d *deliverer) enrich(ctx context.Context, notification *Notification, description string) (string, []string) {
+	if d.openaiClient == nil {
+		return description, nil
+	}
+
+	messages := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: systemPrompt},
+	}
+
+	var runbookTitles []string
+	if d.runbookStore != nil && len(notification.Alerts) > 0 {
+		snippets, err := d.runbookStore.Query(ctx, notification.Alerts[0].Labels, description, d.runbookMaxSnippets, d.runbookSimilarityThreshold)
+		if err != nil {
+			log.Printf("Runbook lookup failed: %v", err)
+		}
+		for _, snippet := range snippets {
+			runbookTitles = append(runbookTitles, snippet.Title)
+			messages = append(messages, openai.ChatCompletionMessage{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: fmt.Sprintf("参考 Runbook《%s》:\n%s", snippet.Title, snippet.Content),
+			})
+		}
+	}
+
+	messages = append(messages, openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleUser,
+		Content: description,
+	})
+
+	log.Printf("Calling OpenAI API for more details...")
+	resp, err := d.openaiClient.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model:    d.openaiModelName,
+		Messages: messages,
+	})
+	if err != nil {
+		log.Printf("OpenAI API call failed: %v", err)
+		return "OpenAI API call failed: " + err.Error(), runbookTitles
+	}
+
+	description = strings.Trim(resp.Choices[0].Message.Content, "```markdown\n")
+	description = strings.Trim(description, "```")
+	log.Printf("Description from OpenAI: %s", description)
+	return description, runbookTitles
+}
+
+// diagramImage generates an AI diagnostic diagram for alert and uploads
+// it through the Feishu app API, returning the resulting image_key.
+// Uploading needs an app_id/app_secret (Feishu's im/v1/images endpoint
+// has no custom-bot equivalent), so this is a no-op whenever the
+// diagram feature or app credentials aren't configured; any failure
+// along the way is logged and treated as "no diagram" so the card still
+// goes out text-only.
+func (d *deliverer) diagramImage(ctx context.Context, alert Alert, summary string) string {
+	if d.diagramPipeline == nil || d.appClient == nil {
+		return ""
+	}
+
+	png, err := d.diagramPipeline.Generate(ctx, alert.Labels, summary)
+	if err != nil {
+		log.Printf("AI diagram generation skipped: %v", err)
+		return ""
+	}
+
+	imageKey, err := d.appClient.UploadImage(ctx, png)
+	if err != nil {
+		log.Printf("AI diagram upload failed: %v", err)
+		return ""
+	}
+	return imageKey
+}
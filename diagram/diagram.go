@@ -0,0 +1,207 @@
+// Package diagram turns an alert's labels into a small diagnostic
+// diagram: it asks a chat model for a Mermaid snippet of the suspected
+// failure path, renders that snippet to PNG with an external CLI, and
+// caches the rendered bytes by prompt hash so repeat alerts don't burn
+// model quota or renderer time.
+package diagram
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"go.etcd.io/bbolt"
+)
+
+var cacheBucket = []byte("diagrams")
+
+const systemPrompt = `你是一名 SRE 工具，只输出一个 Mermaid graph 定义，用于说明一次告警的可疑故障传播路径。
+严格要求：
+- 只输出 Mermaid 代码本身，不要包含解释文字或 Markdown 代码块围栏。
+- 使用 "graph TD" 或 "graph LR"，节点数量不超过 8 个。
+- 节点应体现告警涉及的 service、instance、job 等标签及其上下游关系。`
+
+// Pipeline generates and renders a diagnostic diagram for a firing
+// alert, caching the rendered PNG by prompt hash in a local bbolt file
+// so repeat alerts (same labels+summary) skip the model call and the
+// renderer invocation.
+type Pipeline struct {
+	client    *openai.Client
+	model     string
+	renderCmd string
+
+	db *bbolt.DB
+}
+
+// NewPipeline opens (creating if needed) a bbolt cache at dbPath and
+// returns a Pipeline that generates Mermaid diagrams with model via
+// client and renders them with renderCmd, a Mermaid-CLI compatible
+// binary (e.g. "mmdc") looked up on PATH at render time.
+func NewPipeline(client *openai.Client, model, renderCmd, dbPath string) (*Pipeline, error) {
+	db, err := bbolt.Open(dbPath, 0o600, nil)
+	if err != nil {
+		return nil, fmt.Errorf("open diagram cache %s: %w", dbPath, err)
+	}
+	if err := db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(cacheBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Pipeline{client: client, model: model, renderCmd: renderCmd, db: db}, nil
+}
+
+// Close releases the underlying bbolt file.
+func (p *Pipeline) Close() error {
+	return p.db.Close()
+}
+
+// Generate returns a PNG diagram of the suspected failure path for an
+// alert with the given labels and summary. Results are cached by the
+// hash of the generated prompt, so an identical alert never re-calls the
+// model or the renderer. Callers should treat a non-nil error as "no
+// diagram available" and fall back to a text-only card.
+func (p *Pipeline) Generate(ctx context.Context, labels map[string]string, summary string) ([]byte, error) {
+	prompt := promptFor(labels, summary)
+	hash := promptHash(prompt)
+
+	if cached, ok, err := p.lookup(hash); err != nil {
+		return nil, fmt.Errorf("read diagram cache: %w", err)
+	} else if ok {
+		return cached, nil
+	}
+
+	if _, err := exec.LookPath(p.renderCmd); err != nil {
+		return nil, fmt.Errorf("diagram renderer %q not available: %w", p.renderCmd, err)
+	}
+
+	source, err := p.generateSource(ctx, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("generate mermaid source: %w", err)
+	}
+
+	png, err := p.render(ctx, source)
+	if err != nil {
+		return nil, fmt.Errorf("render diagram: %w", err)
+	}
+
+	if err := p.store(hash, png); err != nil {
+		return nil, fmt.Errorf("write diagram cache: %w", err)
+	}
+	return png, nil
+}
+
+// promptFor builds the user prompt sent to the model from an alert's
+// labels and summary. Labels are sorted for deterministic prompt (and
+// therefore cache key) ordering.
+func promptFor(labels map[string]string, summary string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(summary)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "\n%s=%s", k, labels[k])
+	}
+	return b.String()
+}
+
+func promptHash(prompt string) string {
+	sum := sha256.Sum256([]byte(prompt))
+	return hex.EncodeToString(sum[:])
+}
+
+func (p *Pipeline) lookup(hash string) ([]byte, bool, error) {
+	var png []byte
+	found := false
+	err := p.db.View(func(tx *bbolt.Tx) error {
+		raw := tx.Bucket(cacheBucket).Get([]byte(hash))
+		if raw == nil {
+			return nil
+		}
+		found = true
+		png = append([]byte(nil), raw...)
+		return nil
+	})
+	return png, found, err
+}
+
+func (p *Pipeline) store(hash string, png []byte) error {
+	return p.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(cacheBucket).Put([]byte(hash), png)
+	})
+}
+
+// generateSource asks the chat model for a Mermaid snippet describing
+// the alert's suspected failure path, stripping any code-block fencing
+// the model adds despite the system prompt asking it not to.
+func (p *Pipeline) generateSource(ctx context.Context, prompt string) (string, error) {
+	resp, err := p.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: p.model,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: systemPrompt},
+			{Role: openai.ChatMessageRoleUser, Content: prompt},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("empty chat completion response")
+	}
+
+	source := strings.TrimSpace(resp.Choices[0].Message.Content)
+	source = strings.TrimPrefix(source, "```mermaid")
+	source = strings.TrimPrefix(source, "```")
+	source = strings.TrimSuffix(source, "```")
+	return strings.TrimSpace(source), nil
+}
+
+// renderTimeout bounds how long the external renderer gets before it's
+// killed. mmdc shells out to headless Chromium, which is prone to
+// hanging outright in sandboxed/dependency-less containers; without a
+// deadline of its own a stuck renderer would block the alert that
+// triggered it (and leak its process) forever, since the request
+// context it's called with carries no deadline.
+const renderTimeout = 30 * time.Second
+
+// render shells out to renderCmd to turn a Mermaid snippet into a PNG,
+// via temporary input/output files as mmdc and compatible CLIs expect.
+func (p *Pipeline) render(ctx context.Context, source string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, renderTimeout)
+	defer cancel()
+
+	dir, err := os.MkdirTemp("", "diagram-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	inPath := filepath.Join(dir, "diagram.mmd")
+	outPath := filepath.Join(dir, "diagram.png")
+	if err := os.WriteFile(inPath, []byte(source), 0o600); err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, p.renderCmd, "-i", inPath, "-o", outPath, "-b", "transparent")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %w: %s", p.renderCmd, err, stderr.String())
+	}
+
+	return os.ReadFile(outPath)
+}
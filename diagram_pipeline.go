@@ -0,0 +1,49 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/highkay/grafana-feishu/diagram"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// newDiagramPipeline builds the optional AI diagram pipeline from
+// environment configuration:
+//
+//	ENABLE_AI_IMAGE          "1" to enable AI-generated diagnostic diagrams
+//	AI_IMAGE_MODEL           chat model used to generate the diagram (default: same as OPENAI_MODEL_NAME)
+//	AI_IMAGE_RENDER_CMD      Mermaid-CLI compatible binary used to render PNGs (default "mmdc")
+//	AI_IMAGE_CACHE_DB_PATH   bbolt cache file for generated diagrams (default "diagrams.db")
+//
+// It returns nil when the feature is disabled or OpenAI isn't
+// configured, so callers can skip diagram generation entirely.
+func newDiagramPipeline(openaiClient *openai.Client, defaultModel string) *diagram.Pipeline {
+	if os.Getenv("ENABLE_AI_IMAGE") != "1" {
+		return nil
+	}
+	if openaiClient == nil {
+		log.Println("ENABLE_AI_IMAGE=1 requires OPENAI_API_KEY; AI diagram generation disabled")
+		return nil
+	}
+
+	model := os.Getenv("AI_IMAGE_MODEL")
+	if model == "" {
+		model = defaultModel
+	}
+	renderCmd := os.Getenv("AI_IMAGE_RENDER_CMD")
+	if renderCmd == "" {
+		renderCmd = "mmdc"
+	}
+	dbPath := os.Getenv("AI_IMAGE_CACHE_DB_PATH")
+	if dbPath == "" {
+		dbPath = "diagrams.db"
+	}
+
+	pipeline, err := diagram.NewPipeline(openaiClient, model, renderCmd, dbPath)
+	if err != nil {
+		log.Printf("Failed to initialize AI diagram pipeline: %v", err)
+		return nil
+	}
+	return pipeline
+}
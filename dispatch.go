@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// feishuDispatcher delivers cards to Feishu custom-bot webhooks. It adds
+// the signature fields Feishu's "signature verification" bots require,
+// retries transient failures with exponential backoff, and rate-limits
+// outgoing requests per bot to stay under Feishu's webhook QPS cap.
+type feishuDispatcher struct {
+	client      *http.Client
+	webhookBase string
+
+	defaultSecret string
+	botSecrets    map[string]string
+
+	maxRetries int
+	qps        float64
+
+	mu       sync.Mutex
+	limiters map[string]*qpsLimiter
+}
+
+// newFeishuDispatcher builds a dispatcher from environment configuration:
+//
+//	FEISHU_WEBHOOK_SECRET      default signing secret for custom bots
+//	FEISHU_BOT_SECRETS_FILE    JSON file mapping botUUID -> secret, overrides the default
+//	FEISHU_HTTPS_PROXY         explicit proxy URL (falls back to HTTPS_PROXY/HTTP_PROXY)
+//	FEISHU_INSECURE_SKIP_VERIFY  "1" to skip TLS verification
+//	FEISHU_MAX_RETRIES         retry attempts after the initial send (default 3)
+//	FEISHU_QPS                 max requests per second per bot (default 5)
+func newFeishuDispatcher(webhookBase string) *feishuDispatcher {
+	d := &feishuDispatcher{
+		webhookBase: webhookBase,
+		limiters:    make(map[string]*qpsLimiter),
+		maxRetries:  3,
+		qps:         5,
+	}
+
+	if n := os.Getenv("FEISHU_MAX_RETRIES"); n != "" {
+		if v, err := strconv.Atoi(n); err == nil {
+			d.maxRetries = v
+		}
+	}
+	if n := os.Getenv("FEISHU_QPS"); n != "" {
+		if v, err := strconv.ParseFloat(n, 64); err == nil {
+			d.qps = v
+		}
+	}
+
+	d.defaultSecret = os.Getenv("FEISHU_WEBHOOK_SECRET")
+	if path := os.Getenv("FEISHU_BOT_SECRETS_FILE"); path != "" {
+		secrets, err := loadBotSecrets(path)
+		if err != nil {
+			log.Printf("Failed to load FEISHU_BOT_SECRETS_FILE %s: %v", path, err)
+		} else {
+			d.botSecrets = secrets
+		}
+	}
+
+	transport := &http.Transport{Proxy: http.ProxyFromEnvironment}
+	if proxyURL := os.Getenv("FEISHU_HTTPS_PROXY"); proxyURL != "" {
+		parsed, err := url.Parse(proxyURL)
+		if err != nil {
+			log.Printf("Invalid FEISHU_HTTPS_PROXY %q: %v", proxyURL, err)
+		} else {
+			transport.Proxy = http.ProxyURL(parsed)
+		}
+	}
+	if os.Getenv("FEISHU_INSECURE_SKIP_VERIFY") == "1" {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	d.client = &http.Client{Transport: transport, Timeout: 10 * time.Second}
+
+	return d
+}
+
+// loadBotSecrets reads a JSON object of botUUID -> secret from path.
+func loadBotSecrets(path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	secrets := make(map[string]string)
+	if err := json.Unmarshal(data, &secrets); err != nil {
+		return nil, err
+	}
+	return secrets, nil
+}
+
+// secretFor returns the signing secret to use for botUUID, preferring a
+// per-bot override over the dispatcher default.
+func (d *feishuDispatcher) secretFor(botUUID string) string {
+	if secret, ok := d.botSecrets[botUUID]; ok {
+		return secret
+	}
+	return d.defaultSecret
+}
+
+// signFeishuRequest computes Feishu's custom-bot signature:
+// base64(HMAC-SHA256(key=timestamp+"\n"+secret, message="")).
+func signFeishuRequest(timestamp int64, secret string) (string, error) {
+	stringToSign := fmt.Sprintf("%d\n%s", timestamp, secret)
+	mac := hmac.New(sha256.New, []byte(stringToSign))
+	if _, err := mac.Write([]byte{}); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+func (d *feishuDispatcher) limiterFor(botUUID string) *qpsLimiter {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	l, ok := d.limiters[botUUID]
+	if !ok {
+		l = newQPSLimiter(d.qps)
+		d.limiters[botUUID] = l
+	}
+	return l
+}
+
+// Send delivers card to the bot identified by botUUID, signing it when a
+// secret is configured, rate-limiting per bot, and retrying with
+// exponential backoff on 5xx/429 responses (honoring Retry-After).
+func (d *feishuDispatcher) Send(botUUID string, card *FeishuCard) error {
+	if secret := d.secretFor(botUUID); secret != "" {
+		timestamp := time.Now().Unix()
+		sign, err := signFeishuRequest(timestamp, secret)
+		if err != nil {
+			return fmt.Errorf("sign feishu request: %w", err)
+		}
+		card.Timestamp = strconv.FormatInt(timestamp, 10)
+		card.Sign = sign
+	}
+
+	payload, err := json.Marshal(card)
+	if err != nil {
+		return err
+	}
+	log.Printf("Feishu card JSON: %s", string(payload))
+
+	d.limiterFor(botUUID).Wait()
+
+	webhookURL := d.webhookBase + "/" + botUUID
+	var lastErr error
+	retriedAfterHeader := false
+	for attempt := 0; attempt <= d.maxRetries; attempt++ {
+		if attempt > 0 && !retriedAfterHeader {
+			time.Sleep(backoffDelay(attempt))
+		}
+		retriedAfterHeader = false
+
+		req, err := http.NewRequest("POST", webhookURL, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+
+		resp, err := d.client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		log.Printf("Feishu response (attempt %d): %s", attempt+1, string(body))
+
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			lastErr = fmt.Errorf("feishu webhook returned %d", resp.StatusCode)
+			if retryAfter := retryAfterDelay(resp.Header.Get("Retry-After")); retryAfter > 0 {
+				time.Sleep(retryAfter)
+				retriedAfterHeader = true
+			}
+			continue
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("giving up after %d attempts: %w", d.maxRetries+1, lastErr)
+}
+
+func backoffDelay(attempt int) time.Duration {
+	return time.Duration(math.Pow(2, float64(attempt))) * 500 * time.Millisecond
+}
+
+func retryAfterDelay(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(header); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if when, err := http.ParseTime(header); err == nil {
+		return time.Until(when)
+	}
+	return 0
+}
+
+// qpsLimiter is a minimal token-bucket-of-one limiter: it blocks the
+// caller until enough time has passed since the last send to respect the
+// configured rate. Sized for per-bot webhook throttling, not general use.
+type qpsLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	last     time.Time
+}
+
+func newQPSLimiter(qps float64) *qpsLimiter {
+	if qps <= 0 {
+		qps = 1
+	}
+	return &qpsLimiter{interval: time.Duration(float64(time.Second) / qps)}
+}
+
+func (l *qpsLimiter) Wait() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if wait := l.last.Add(l.interval).Sub(time.Now()); wait > 0 {
+		time.Sleep(wait)
+	}
+	l.last = time.Now()
+}
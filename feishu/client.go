@@ -0,0 +1,285 @@
+// Package feishu is a small client for the Feishu/Lark Open Platform
+// app API, as opposed to the simpler custom-bot webhooks. It exchanges
+// an app_id/app_secret pair for a tenant_access_token and uses it to
+// send interactive cards to chats, users, or emails.
+package feishu
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	tenantAccessTokenURL = "https://open.feishu.cn/open-apis/auth/v3/tenant_access_token/internal"
+	sendMessageURL       = "https://open.feishu.cn/open-apis/im/v1/messages"
+	uploadImageURL       = "https://open.feishu.cn/open-apis/im/v1/images"
+)
+
+// Client is a concurrent-safe Feishu Open Platform client for a single
+// app_id/app_secret pair. The zero value is not usable; construct one
+// with NewClient.
+type Client struct {
+	appID      string
+	appSecret  string
+	httpClient *http.Client
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// NewClient builds a Client for the given app credentials.
+func NewClient(appID, appSecret string) *Client {
+	return &Client{
+		appID:      appID,
+		appSecret:  appSecret,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type tenantAccessTokenResponse struct {
+	Code              int    `json:"code"`
+	Msg               string `json:"msg"`
+	TenantAccessToken string `json:"tenant_access_token"`
+	Expire            int    `json:"expire"`
+}
+
+// tenantAccessToken returns a cached tenant_access_token, fetching and
+// caching a new one if it is missing or close to expiry.
+func (c *Client) tenantAccessToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && time.Now().Before(c.expiresAt) {
+		return c.token, nil
+	}
+
+	reqBody, err := json.Marshal(map[string]string{
+		"app_id":     c.appID,
+		"app_secret": c.appSecret,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", tenantAccessTokenURL, bytes.NewReader(reqBody))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	var parsed tenantAccessTokenResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return "", fmt.Errorf("decode tenant_access_token response: %w", err)
+	}
+	if parsed.Code != 0 {
+		return "", fmt.Errorf("tenant_access_token request failed: %d %s", parsed.Code, parsed.Msg)
+	}
+
+	c.token = parsed.TenantAccessToken
+	// Refresh a minute early so a call racing against expiry never sees a stale token.
+	c.expiresAt = time.Now().Add(time.Duration(parsed.Expire)*time.Second - time.Minute)
+
+	return c.token, nil
+}
+
+type sendMessageRequest struct {
+	ReceiveID string `json:"receive_id"`
+	MsgType   string `json:"msg_type"`
+	Content   string `json:"content"`
+}
+
+type sendMessageResponse struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+	Data struct {
+		MessageID string `json:"message_id"`
+	} `json:"data"`
+}
+
+// SendInteractive posts an interactive card to receiveID and returns the
+// resulting message_id (needed to later PatchInteractive the same card).
+// receiveIDType selects how receiveID is interpreted: "chat_id",
+// "open_id", "email", or "user_id". card is marshaled to JSON and sent
+// as the message content.
+func (c *Client) SendInteractive(ctx context.Context, receiveID, receiveIDType string, card interface{}) (string, error) {
+	token, err := c.tenantAccessToken(ctx)
+	if err != nil {
+		return "", fmt.Errorf("get tenant_access_token: %w", err)
+	}
+
+	content, err := json.Marshal(card)
+	if err != nil {
+		return "", err
+	}
+
+	reqBody, err := json.Marshal(sendMessageRequest{
+		ReceiveID: receiveID,
+		MsgType:   "interactive",
+		Content:   string(content),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	url := fmt.Sprintf("%s?receive_id_type=%s", sendMessageURL, receiveIDType)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(reqBody))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	var parsed sendMessageResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return "", fmt.Errorf("decode send message response: %w", err)
+	}
+	if parsed.Code != 0 {
+		return "", fmt.Errorf("send message failed: %d %s", parsed.Code, parsed.Msg)
+	}
+
+	return parsed.Data.MessageID, nil
+}
+
+type patchMessageRequest struct {
+	Content string `json:"content"`
+}
+
+// PatchInteractive updates the content of a previously sent interactive
+// card, used to coalesce repeat alert firings into a single message
+// instead of spamming new ones.
+func (c *Client) PatchInteractive(ctx context.Context, messageID string, card interface{}) error {
+	token, err := c.tenantAccessToken(ctx)
+	if err != nil {
+		return fmt.Errorf("get tenant_access_token: %w", err)
+	}
+
+	content, err := json.Marshal(card)
+	if err != nil {
+		return err
+	}
+
+	reqBody, err := json.Marshal(patchMessageRequest{Content: string(content)})
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/%s", sendMessageURL, messageID)
+	req, err := http.NewRequestWithContext(ctx, "PATCH", url, bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var parsed sendMessageResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return fmt.Errorf("decode patch message response: %w", err)
+	}
+	if parsed.Code != 0 {
+		return fmt.Errorf("patch message failed: %d %s", parsed.Code, parsed.Msg)
+	}
+
+	return nil
+}
+
+type uploadImageResponse struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+	Data struct {
+		ImageKey string `json:"image_key"`
+	} `json:"data"`
+}
+
+// UploadImage uploads png (or jpg) image bytes for use in a card's img
+// element and returns the resulting image_key.
+func (c *Client) UploadImage(ctx context.Context, image []byte) (string, error) {
+	token, err := c.tenantAccessToken(ctx)
+	if err != nil {
+		return "", fmt.Errorf("get tenant_access_token: %w", err)
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	if err := writer.WriteField("image_type", "message"); err != nil {
+		return "", err
+	}
+	part, err := writer.CreateFormFile("image", "diagram.png")
+	if err != nil {
+		return "", err
+	}
+	if _, err := part.Write(image); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", uploadImageURL, &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	var parsed uploadImageResponse
+	if err := json.Unmarshal(respBody, &parsed); err != nil {
+		return "", fmt.Errorf("decode upload image response: %w", err)
+	}
+	if parsed.Code != 0 {
+		return "", fmt.Errorf("upload image failed: %d %s", parsed.Code, parsed.Msg)
+	}
+
+	return parsed.Data.ImageKey, nil
+}
@@ -0,0 +1,133 @@
+// Package routing implements an Alertmanager-style route/receivers tree:
+// match incoming alert labels against regexes to pick a receiver and a
+// pair of Go text/template strings to render the card title and body.
+package routing
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Receiver is a delivery target: either a custom-bot webhook (BotUUID)
+// or a Feishu Open Platform chat (ChatID), matching the two delivery
+// modes the bridge supports.
+type Receiver struct {
+	Name    string `yaml:"name"`
+	BotUUID string `yaml:"bot_uuid"`
+	ChatID  string `yaml:"chat_id"`
+}
+
+// Route matches alerts by label regex and says how to render and where
+// to send them. Routes are evaluated in file order; the first whose
+// Match regexes all pass wins.
+type Route struct {
+	Match         map[string]string `yaml:"match"`
+	Receiver      string            `yaml:"receiver"`
+	TitleTemplate string            `yaml:"title_template"`
+	BodyTemplate  string            `yaml:"body_template"`
+	AIEnrichment  *bool             `yaml:"ai_enrichment"`
+	Colors        map[string]string `yaml:"colors"`
+	Mentions      []string          `yaml:"mentions"`
+
+	compiled map[string]*regexp.Regexp
+}
+
+// Dedup configures the repeat-firing coalescing window.
+type Dedup struct {
+	Window time.Duration `yaml:"-"`
+	Raw    string        `yaml:"window"`
+}
+
+// Config is the top-level routes.yaml document.
+type Config struct {
+	Routes    []Route    `yaml:"routes"`
+	Receivers []Receiver `yaml:"receivers"`
+	Dedup     Dedup      `yaml:"dedup"`
+}
+
+// LoadConfig reads and validates a routes.yaml file at path.
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	for i := range cfg.Routes {
+		if err := cfg.Routes[i].compile(); err != nil {
+			return nil, fmt.Errorf("route %d: %w", i, err)
+		}
+	}
+
+	if cfg.Dedup.Raw != "" {
+		window, err := time.ParseDuration(cfg.Dedup.Raw)
+		if err != nil {
+			return nil, fmt.Errorf("parse dedup.window: %w", err)
+		}
+		cfg.Dedup.Window = window
+	}
+
+	return &cfg, nil
+}
+
+func (r *Route) compile() error {
+	r.compiled = make(map[string]*regexp.Regexp, len(r.Match))
+	for label, pattern := range r.Match {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("match %s: %w", label, err)
+		}
+		r.compiled[label] = re
+	}
+	return nil
+}
+
+// matches reports whether every Match regex in r matches the
+// corresponding label value in labels. A route with no Match entries
+// matches everything, acting as a catch-all default.
+func (r *Route) matches(labels map[string]string) bool {
+	for label, re := range r.compiled {
+		if !re.MatchString(labels[label]) {
+			return false
+		}
+	}
+	return true
+}
+
+// EnrichAI reports whether this route wants AI enrichment, defaulting to
+// true (the bridge's original behavior) when unset.
+func (r *Route) EnrichAI() bool {
+	if r.AIEnrichment == nil {
+		return true
+	}
+	return *r.AIEnrichment
+}
+
+// Match returns the first route whose Match regexes all pass against
+// labels, or ok=false if none do.
+func (c *Config) Match(labels map[string]string) (Route, bool) {
+	for _, route := range c.Routes {
+		if route.matches(labels) {
+			return route, true
+		}
+	}
+	return Route{}, false
+}
+
+// ReceiverByName looks up a configured receiver, or ok=false if unknown.
+func (c *Config) ReceiverByName(name string) (Receiver, bool) {
+	for _, r := range c.Receivers {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return Receiver{}, false
+}
@@ -0,0 +1,35 @@
+package routing
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+)
+
+// AlertData is the context exposed to title/body templates.
+type AlertData struct {
+	Status            string
+	Labels            map[string]string
+	Annotations       map[string]string
+	CommonLabels      map[string]string
+	CommonAnnotations map[string]string
+	StartsAt          string
+	EndsAt            string
+	GeneratorURL      string
+	ExternalURL       string
+	Mentions          []string
+}
+
+// Render executes a text/template string against data.
+func Render(tmplText string, data AlertData) (string, error) {
+	tmpl, err := template.New("route").Parse(tmplText)
+	if err != nil {
+		return "", fmt.Errorf("parse template: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("execute template: %w", err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/highkay/grafana-feishu/dedup"
+	"github.com/highkay/grafana-feishu/routing"
+)
+
+// newRoutingConfig loads the optional per-alert routing pipeline:
+//
+//	ROUTE_CONFIG_FILE   path to a routes.yaml (à la Alertmanager's route/receivers tree); unset disables routing
+//	DEDUP_DB_PATH       bbolt file backing the dedup store (default "dedup.db")
+//
+// Both return values are nil when routing/dedup aren't configured, so
+// callers fall back to the bridge's original single-handler behavior.
+func newRoutingConfig() (*routing.Config, *dedup.Store) {
+	path := os.Getenv("ROUTE_CONFIG_FILE")
+	if path == "" {
+		return nil, nil
+	}
+
+	cfg, err := routing.LoadConfig(path)
+	if err != nil {
+		log.Printf("Failed to load %s: %v; routing disabled", path, err)
+		return nil, nil
+	}
+
+	var dedupStore *dedup.Store
+	if cfg.Dedup.Window > 0 {
+		dbPath := os.Getenv("DEDUP_DB_PATH")
+		if dbPath == "" {
+			dbPath = "dedup.db"
+		}
+		dedupStore, err = dedup.NewStore(dbPath, cfg.Dedup.Window)
+		if err != nil {
+			log.Printf("Failed to open dedup store %s: %v; dedup disabled", dbPath, err)
+		}
+	}
+
+	return cfg, dedupStore
+}
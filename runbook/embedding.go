@@ -0,0 +1,193 @@
+package runbook
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	openai "github.com/sashabaranov/go-openai"
+	"go.etcd.io/bbolt"
+)
+
+var embeddingsBucket = []byte("embeddings")
+
+// embeddingRecord is what gets cached in bbolt, keyed by the sha256 of
+// the runbook's title and content so unchanged runbooks skip re-embedding on
+// restart.
+type embeddingRecord struct {
+	Title   string    `json:"title"`
+	Content string    `json:"content"`
+	Vector  []float32 `json:"vector"`
+}
+
+// EmbeddingStore matches alerts against runbooks by cosine similarity
+// between an OpenAI embedding of the alert's labels+summary and
+// precomputed embeddings of each runbook. Embeddings are cached in a
+// local bbolt file keyed by content hash, so restarts only re-embed
+// runbooks that actually changed.
+type EmbeddingStore struct {
+	client *openai.Client
+	model  openai.EmbeddingModel
+	db     *bbolt.DB
+
+	mu      sync.RWMutex
+	records []embeddingRecord
+}
+
+// NewEmbeddingStore loads runbooks from dir, embeds any whose content
+// hash isn't already cached in dbPath, and persists the result there.
+func NewEmbeddingStore(ctx context.Context, client *openai.Client, model openai.EmbeddingModel, dbPath, runbookDir string) (*EmbeddingStore, error) {
+	db, err := bbolt.Open(dbPath, 0o600, nil)
+	if err != nil {
+		return nil, fmt.Errorf("open embedding cache %s: %w", dbPath, err)
+	}
+	if err := db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(embeddingsBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s := &EmbeddingStore{client: client, model: model, db: db}
+	if err := s.sync(ctx, runbookDir); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// sync embeds any runbook in dir whose content hash isn't already
+// cached, writes new entries to bbolt, and loads all records into memory
+// for query-time cosine similarity.
+func (s *EmbeddingStore) sync(ctx context.Context, dir string) error {
+	docs, err := loadDocs(dir)
+	if err != nil {
+		return err
+	}
+
+	records := make([]embeddingRecord, 0, len(docs))
+	for _, d := range docs {
+		hash := contentHash(d.Title + "\n" + d.Content)
+
+		var cached embeddingRecord
+		found := false
+		if err := s.db.View(func(tx *bbolt.Tx) error {
+			raw := tx.Bucket(embeddingsBucket).Get([]byte(hash))
+			if raw == nil {
+				return nil
+			}
+			found = true
+			return json.Unmarshal(raw, &cached)
+		}); err != nil {
+			return fmt.Errorf("read embedding cache: %w", err)
+		}
+
+		if found {
+			records = append(records, cached)
+			continue
+		}
+
+		vector, err := s.embed(ctx, d.Title+"\n"+d.Content)
+		if err != nil {
+			return fmt.Errorf("embed runbook %q: %w", d.Title, err)
+		}
+		record := embeddingRecord{Title: d.Title, Content: d.Content, Vector: vector}
+
+		raw, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		if err := s.db.Update(func(tx *bbolt.Tx) error {
+			return tx.Bucket(embeddingsBucket).Put([]byte(hash), raw)
+		}); err != nil {
+			return fmt.Errorf("write embedding cache: %w", err)
+		}
+
+		records = append(records, record)
+	}
+
+	s.mu.Lock()
+	s.records = records
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *EmbeddingStore) embed(ctx context.Context, text string) ([]float32, error) {
+	resp, err := s.client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
+		Input: []string{text},
+		Model: s.model,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Data) == 0 {
+		return nil, fmt.Errorf("empty embeddings response")
+	}
+	return resp.Data[0].Embedding, nil
+}
+
+// Query embeds labels+summary and returns the runbooks with the highest
+// cosine similarity, filtered to similarityThreshold and capped at
+// maxSnippets.
+func (s *EmbeddingStore) Query(ctx context.Context, labels map[string]string, summary string, maxSnippets int, similarityThreshold float64) ([]Snippet, error) {
+	query := summary
+	for k, v := range labels {
+		query += fmt.Sprintf(" %s=%s", k, v)
+	}
+
+	vector, err := s.embed(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("embed alert: %w", err)
+	}
+
+	s.mu.RLock()
+	records := s.records
+	s.mu.RUnlock()
+
+	matches := make([]Snippet, 0, len(records))
+	for _, r := range records {
+		score := cosineSimilarity(vector, r.Vector)
+		if score < similarityThreshold {
+			continue
+		}
+		matches = append(matches, Snippet{Title: r.Title, Content: r.Content, Score: score})
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	if len(matches) > maxSnippets {
+		matches = matches[:maxSnippets]
+	}
+	return matches, nil
+}
+
+// Close releases the underlying bbolt file.
+func (s *EmbeddingStore) Close() error {
+	return s.db.Close()
+}
+
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
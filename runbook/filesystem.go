@@ -0,0 +1,43 @@
+package runbook
+
+import (
+	"context"
+	"sort"
+)
+
+// FilesystemStore matches alert labels against the `labels:` selector in
+// each runbook's front matter using Jaccard similarity. It loads every
+// runbooks/*.md file once at construction; restart the process (or build
+// a new store) to pick up added or edited runbooks.
+type FilesystemStore struct {
+	docs []doc
+}
+
+// NewFilesystemStore loads all *.md runbooks under dir.
+func NewFilesystemStore(dir string) (*FilesystemStore, error) {
+	docs, err := loadDocs(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &FilesystemStore{docs: docs}, nil
+}
+
+// Query scores every loaded runbook's label selector against labels and
+// returns the best matches at or above similarityThreshold. summary is unused;
+// this store only matches on labels.
+func (s *FilesystemStore) Query(_ context.Context, labels map[string]string, _ string, maxSnippets int, similarityThreshold float64) ([]Snippet, error) {
+	matches := make([]Snippet, 0, len(s.docs))
+	for _, d := range s.docs {
+		score := jaccardSimilarity(labels, d.Labels)
+		if score < similarityThreshold {
+			continue
+		}
+		matches = append(matches, Snippet{Title: d.Title, Content: d.Content, Score: score})
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	if len(matches) > maxSnippets {
+		matches = matches[:maxSnippets]
+	}
+	return matches, nil
+}
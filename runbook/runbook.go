@@ -0,0 +1,117 @@
+// Package runbook provides retrieval of operator-authored runbook
+// snippets that get injected into the AI enrichment prompt, so responders
+// see advice grounded in this team's own documentation rather than only
+// the model's generic knowledge.
+package runbook
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Snippet is a single runbook match returned by a Store.
+type Snippet struct {
+	Title   string
+	Content string
+	Score   float64
+}
+
+// Store looks up runbook snippets relevant to a firing alert. labels are
+// the alert's label set (alertname, job, severity, instance, ...) and
+// summary is a short human-readable description of the alert.
+// Implementations return at most maxSnippets matches, each scoring at or
+// above similarityThreshold, ordered by descending relevance.
+type Store interface {
+	Query(ctx context.Context, labels map[string]string, summary string, maxSnippets int, similarityThreshold float64) ([]Snippet, error)
+}
+
+// doc is a parsed runbooks/*.md file: YAML front matter plus the
+// remaining markdown body.
+type doc struct {
+	Title   string            `yaml:"title"`
+	Labels  map[string]string `yaml:"labels"`
+	Content string
+}
+
+// loadDocs parses every *.md file in dir as a front-matter runbook.
+func loadDocs(dir string) ([]doc, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.md"))
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make([]doc, 0, len(paths))
+	for _, path := range paths {
+		raw, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", path, err)
+		}
+		d, err := parseFrontMatter(raw)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+		if d.Title == "" {
+			d.Title = strings.TrimSuffix(filepath.Base(path), ".md")
+		}
+		docs = append(docs, d)
+	}
+	return docs, nil
+}
+
+// parseFrontMatter splits a "---\n<yaml>\n---\n<markdown>" document into
+// its front matter and body.
+func parseFrontMatter(raw []byte) (doc, error) {
+	const delim = "---"
+	text := string(raw)
+
+	if !strings.HasPrefix(strings.TrimLeft(text, "\uFEFF"), delim) {
+		return doc{Content: text}, nil
+	}
+	text = strings.TrimPrefix(strings.TrimLeft(text, "\uFEFF"), delim)
+
+	end := strings.Index(text, "\n"+delim)
+	if end == -1 {
+		return doc{}, fmt.Errorf("unterminated front matter")
+	}
+
+	var d doc
+	if err := yaml.Unmarshal([]byte(text[:end]), &d); err != nil {
+		return doc{}, err
+	}
+	d.Content = strings.TrimSpace(text[end+len(delim)+1:])
+	return d, nil
+}
+
+// jaccardSimilarity scores two label sets by the Jaccard index of their
+// "key=value" pairs.
+func jaccardSimilarity(a, b map[string]string) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 0
+	}
+
+	pairs := func(m map[string]string) map[string]struct{} {
+		set := make(map[string]struct{}, len(m))
+		for k, v := range m {
+			set[k+"="+v] = struct{}{}
+		}
+		return set
+	}
+	setA, setB := pairs(a), pairs(b)
+
+	intersection := 0
+	for k := range setA {
+		if _, ok := setB[k]; ok {
+			intersection++
+		}
+	}
+	union := len(setA) + len(setB) - intersection
+	if union == 0 {
+		return 0
+	}
+	return float64(intersection) / float64(union)
+}
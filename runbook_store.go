@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/highkay/grafana-feishu/runbook"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// newRunbookStore builds the configured runbook.Store from environment
+// variables:
+//
+//	RUNBOOK_STORE                  "filesystem", "embedding", or unset to disable
+//	RUNBOOK_DIR                    directory of *.md runbooks (default "./runbooks")
+//	RUNBOOK_MAX_SNIPPETS           max runbook snippets injected per alert (default 2)
+//	RUNBOOK_SIMILARITY_THRESHOLD   minimum match score, 0-1 (default 0.2)
+//	RUNBOOK_EMBEDDING_DB_PATH      bbolt cache file for the embedding store (default "runbooks.db")
+//	RUNBOOK_EMBEDDING_MODEL        OpenAI embedding model (default text-embedding-ada-002)
+//
+// It returns nil when no store is configured, so callers can skip
+// retrieval entirely.
+func newRunbookStore(openaiClient *openai.Client) (store runbook.Store, maxSnippets int, similarityThreshold float64) {
+	maxSnippets = 2
+	if n := os.Getenv("RUNBOOK_MAX_SNIPPETS"); n != "" {
+		if v, err := strconv.Atoi(n); err == nil {
+			maxSnippets = v
+		}
+	}
+	similarityThreshold = 0.2
+	if n := os.Getenv("RUNBOOK_SIMILARITY_THRESHOLD"); n != "" {
+		if v, err := strconv.ParseFloat(n, 64); err == nil {
+			similarityThreshold = v
+		}
+	}
+
+	mode := os.Getenv("RUNBOOK_STORE")
+	if mode == "" {
+		return nil, maxSnippets, similarityThreshold
+	}
+
+	runbookDir := os.Getenv("RUNBOOK_DIR")
+	if runbookDir == "" {
+		runbookDir = "./runbooks"
+	}
+
+	switch mode {
+	case "filesystem":
+		fsStore, err := runbook.NewFilesystemStore(runbookDir)
+		if err != nil {
+			log.Printf("Failed to load runbooks from %s: %v", runbookDir, err)
+			return nil, maxSnippets, similarityThreshold
+		}
+		return fsStore, maxSnippets, similarityThreshold
+
+	case "embedding":
+		if openaiClient == nil {
+			log.Println("RUNBOOK_STORE=embedding requires OPENAI_API_KEY; runbook retrieval disabled")
+			return nil, maxSnippets, similarityThreshold
+		}
+		dbPath := os.Getenv("RUNBOOK_EMBEDDING_DB_PATH")
+		if dbPath == "" {
+			dbPath = "runbooks.db"
+		}
+		model := openai.EmbeddingModel(os.Getenv("RUNBOOK_EMBEDDING_MODEL"))
+		if model == "" {
+			model = openai.AdaEmbeddingV2
+		}
+		embeddingStore, err := runbook.NewEmbeddingStore(context.Background(), openaiClient, model, dbPath, runbookDir)
+		if err != nil {
+			log.Printf("Failed to initialize embedding runbook store: %v", err)
+			return nil, maxSnippets, similarityThreshold
+		}
+		return embeddingStore, maxSnippets, similarityThreshold
+
+	default:
+		log.Printf("Unknown RUNBOOK_STORE mode %q; runbook retrieval disabled", mode)
+		return nil, maxSnippets, similarityThreshold
+	}
+}
@@ -1,19 +1,22 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
-	"io/ioutil"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
 	"log"
-	"net/http"
 	"os"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/basicauth"
 	"github.com/gofiber/fiber/v2/middleware/logger"
+	"github.com/highkay/grafana-feishu/feishu"
 	openai "github.com/sashabaranov/go-openai"
 )
 
@@ -67,13 +70,19 @@ type Alert struct {
 }
 
 type FeishuCard struct {
-	MsgType string            `json:"msg_type"`
-	Card    FeishuCardContent `json:"card"`
+	Timestamp string            `json:"timestamp,omitempty"`
+	Sign      string            `json:"sign,omitempty"`
+	MsgType   string            `json:"msg_type"`
+	Card      FeishuCardContent `json:"card"`
 }
 
 type FeishuCardContent struct {
-	Header   FeishuCardHeader       `json:"header"`
-	Elements []FeishuCardDivElement `json:"elements"`
+	Header FeishuCardHeader `json:"header"`
+	// Elements holds a mix of FeishuCardDivElement (text),
+	// FeishuCardNoteElement (footers), FeishuCardImgElement (images) and
+	// FeishuCardActionElement (buttons), matching Feishu's own
+	// heterogeneous "elements" array.
+	Elements []interface{} `json:"elements"`
 }
 
 type FeishuCardHeader struct {
@@ -91,8 +100,66 @@ type FeishuCardDivElement struct {
 	Text FeishuCardTextElement `json:"text"`
 }
 
+// FeishuCardNoteElement renders the small gray footer text Feishu calls
+// a "note" component. Unlike div, note takes an Elements array of
+// text objects rather than a single Text field; used (with lark_md text) for
+// the mentions and runbook-reference footers.
+type FeishuCardNoteElement struct {
+	Tag      string                  `json:"tag"`
+	Elements []FeishuCardTextElement `json:"elements"`
+}
+
+// FeishuCardActionElement renders a row of buttons, used for the
+// silence/acknowledge/runbook actions on alert cards.
+type FeishuCardActionElement struct {
+	Tag     string             `json:"tag"`
+	Actions []FeishuCardButton `json:"actions"`
+}
+
+type FeishuCardButton struct {
+	Tag   string                `json:"tag"`
+	Text  FeishuCardTextElement `json:"text"`
+	Type  string                `json:"type"`
+	URL   string                `json:"url,omitempty"`
+	Value map[string]string     `json:"value,omitempty"`
+}
+
+// FeishuCardImgElement renders an uploaded image inline on the card,
+// used for the AI-generated diagnostic diagram.
+type FeishuCardImgElement struct {
+	Tag    string                `json:"tag"`
+	ImgKey string                `json:"img_key"`
+	Alt    FeishuCardTextElement `json:"alt"`
+	Mode   string                `json:"mode,omitempty"`
+}
+
 var defaultWebhookBase string = "https://open.feishu.cn/open-apis/bot/v2/hook"
 
+// cardActionTTL bounds how long a Silence/Acknowledge button stays valid
+// before its signed value is rejected as expired.
+const cardActionTTL = 24 * time.Hour
+
+// verifyWebhookSignature checks that sig (the raw value of the configured
+// signature header, e.g. "sha256=<hex>") matches the HMAC-SHA256 of body
+// keyed by secret. It accepts both the "sha256=" prefixed form used by
+// GitHub-style relays and a bare hex digest.
+func verifyWebhookSignature(sig []byte, body []byte, secret string) error {
+	if len(sig) == 0 {
+		return fmt.Errorf("missing signature header")
+	}
+	expectedHex := strings.TrimPrefix(string(sig), "sha256=")
+	expected, err := hex.DecodeString(expectedHex)
+	if err != nil {
+		return fmt.Errorf("malformed signature header: %w", err)
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	if !hmac.Equal(expected, mac.Sum(nil)) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
 func main() {
 	var feishuWebhookBase string
 	var defaultBotUUID string
@@ -121,9 +188,90 @@ func main() {
 		openaiModelName = openai.GPT3Dot5Turbo
 	}
 
+	var openaiClient *openai.Client
+	if openaiToken != "" {
+		config := openai.DefaultConfig(openaiToken)
+		if openaiBaseURL != "" {
+			config.BaseURL = openaiBaseURL
+		}
+		openaiClient = openai.NewClientWithConfig(config)
+	}
+
+	runbookStore, runbookMaxSnippets, runbookSimilarityThreshold := newRunbookStore(openaiClient)
+	if closer, ok := runbookStore.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	hmacSecret := os.Getenv("WEBHOOK_HMAC_SECRET")
+	hmacHeader := os.Getenv("WEBHOOK_HMAC_HEADER")
+	if hmacHeader == "" {
+		hmacHeader = "X-Signature-256"
+	}
+
+	dispatcher := newFeishuDispatcher(feishuWebhookBase)
+
+	// App mode sends through the Feishu Open Platform API instead of a
+	// custom-bot webhook, unlocking @mentions and private-chat delivery.
+	// The custom-bot path above remains the fallback when no app
+	// credentials are configured or a notification carries no chat route.
+	feishuMode := os.Getenv("FEISHU_DELIVERY_MODE")
+	var appClient *feishu.Client
+	if feishuMode == "app" {
+		appID := os.Getenv("FEISHU_APP_ID")
+		appSecret := os.Getenv("FEISHU_APP_SECRET")
+		if appID == "" || appSecret == "" {
+			log.Println("FEISHU_DELIVERY_MODE=app but FEISHU_APP_ID/FEISHU_APP_SECRET are not set; falling back to custom-bot mode")
+		} else {
+			appClient = feishu.NewClient(appID, appSecret)
+		}
+	}
+	defaultReceiveIDType := os.Getenv("FEISHU_DEFAULT_RECEIVE_ID_TYPE")
+	if defaultReceiveIDType == "" {
+		defaultReceiveIDType = "chat_id"
+	}
+
+	// Card actions (silence/acknowledge buttons) only render when a
+	// signing secret is configured; the callback endpoint needs the same
+	// secret plus an Alertmanager URL to act on them.
+	cardActionSecret := os.Getenv("FEISHU_CARD_ACTION_SECRET")
+	alertmanagerURL := os.Getenv("ALERTMANAGER_URL")
+	if cardActionSecret != "" && alertmanagerURL == "" {
+		log.Println("FEISHU_CARD_ACTION_SECRET is set but ALERTMANAGER_URL is not; card actions will be disabled")
+		cardActionSecret = ""
+	}
+
+	routingConfig, dedupStore := newRoutingConfig()
+	if dedupStore != nil {
+		defer dedupStore.Close()
+	}
+
+	diagramPipeline := newDiagramPipeline(openaiClient, openaiModelName)
+	if diagramPipeline != nil {
+		defer diagramPipeline.Close()
+	}
+
+	delivery := &deliverer{
+		dispatcher:                 dispatcher,
+		appClient:                  appClient,
+		defaultReceiveIDType:       defaultReceiveIDType,
+		openaiClient:               openaiClient,
+		openaiModelName:            openaiModelName,
+		runbookStore:               runbookStore,
+		runbookMaxSnippets:         runbookMaxSnippets,
+		runbookSimilarityThreshold: runbookSimilarityThreshold,
+		cardActionSecret:           cardActionSecret,
+		routingConfig:              routingConfig,
+		dedupStore:                 dedupStore,
+		diagramPipeline:            diagramPipeline,
+	}
+
 	app := fiber.New()
 	app.Use(logger.New())
 
+	if cardActionSecret != "" {
+		registerFeishuCallback(app, os.Getenv("FEISHU_CALLBACK_ENCRYPT_KEY"), cardActionSecret, alertmanagerURL)
+	}
+
 	webhookAuth := os.Getenv("WEBHOOK_AUTH")
 	if webhookAuth != "" {
 		log.Printf("Enabling basic auth")
@@ -137,96 +285,24 @@ func main() {
 
 	app.Post("/:botUUID?", func(c *fiber.Ctx) error {
 		c.Accepts("application/json")
-		notification := new(Notification)
-		if err := c.BodyParser(notification); err != nil {
-			return err
-		}
-
-		title, ok := notification.CommonAnnotations["summary"]
-		if !ok {
-			title = notification.Title
-		}
-
-		description, ok := notification.CommonAnnotations["description"]
-		if !ok {
-			description = notification.Message
-		}
-
-		color := "red"
-		if notification.Status == "resolved" {
-			color = "green"
-		}
 
-		if openaiToken != "" {
-			log.Printf("Calling OpenAI API for more details...")
-			config := openai.DefaultConfig(openaiToken)
-			if openaiBaseURL != "" {
-				config.BaseURL = openaiBaseURL
-			}
-			client := openai.NewClientWithConfig(config)
-			resp, err := client.CreateChatCompletion(
-				context.Background(),
-				openai.ChatCompletionRequest{
-					Model: openaiModelName,
-					Messages: []openai.ChatCompletionMessage{
-						{
-							Role:    openai.ChatMessageRoleSystem,
-							Content: systemPrompt,
-						},
-						{
-							Role:    openai.ChatMessageRoleUser,
-							Content: description,
-						},
-					},
-				},
-			)
-			if err != nil {
-				log.Printf("OpenAI API call failed: %v", err)
-				description = "OpenAI API call failed: " + err.Error()
-			} else {
-				description = strings.Trim(resp.Choices[0].Message.Content, "```markdown\n")
-				description = strings.Trim(description, "```")
-				log.Printf("Description from OpenAI: %s", description)
+		if hmacSecret != "" {
+			if err := verifyWebhookSignature(c.Request().Header.Peek(hmacHeader), c.Body(), hmacSecret); err != nil {
+				log.Printf("Rejecting webhook: %v", err)
+				return c.SendStatus(fiber.StatusUnauthorized)
 			}
 		}
 
-		feishuCard := &FeishuCard{
-			MsgType: "interactive",
-			Card: FeishuCardContent{
-				Header: FeishuCardHeader{
-					Title: FeishuCardTextElement{
-						Tag:     "plain_text",
-						Content: title,
-					},
-					Template: color,
-				},
-				Elements: []FeishuCardDivElement{
-					{
-						Tag: "div",
-						Text: FeishuCardTextElement{
-							Tag:     "lark_md",
-							Content: description,
-						},
-					},
-				},
-			},
-		}
-		feishuJson, err := json.Marshal(feishuCard)
-		if err != nil {
+		notification := new(Notification)
+		if err := c.BodyParser(notification); err != nil {
 			return err
 		}
-		log.Printf("Feishu card JSON: %s", string(feishuJson))
+
 		botUUID := c.Params("botUUID", defaultBotUUID)
-		feishuWebhookURL := feishuWebhookBase + "/" + botUUID
-		request, err := http.NewRequest("POST", feishuWebhookURL, bytes.NewBuffer(feishuJson))
-		request.Header.Set("Content-Type", "application/json; charset=UTF-8")
-		response, err := http.DefaultClient.Do(request)
-		if err != nil {
+		if err := delivery.Deliver(context.Background(), botUUID, notification); err != nil {
+			log.Printf("Failed to deliver Feishu card: %v", err)
 			return err
 		}
-		defer response.Body.Close()
-		body, _ := ioutil.ReadAll(response.Body)
-		log.Printf("Response body: %s", string(body))
 
 		return c.SendStatus(204)
 	})
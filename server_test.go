@@ -0,0 +1,39 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	secret := "s3cr3t"
+	body := []byte(`{"alerts":[]}`)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	validHex := hex.EncodeToString(mac.Sum(nil))
+
+	cases := []struct {
+		name    string
+		sig     []byte
+		wantErr bool
+	}{
+		{"matching signature with sha256= prefix", []byte("sha256=" + validHex), false},
+		{"matching signature without prefix", []byte(validHex), false},
+		{"mismatched signature", []byte("sha256=" + strings.Repeat("0", len(validHex))), true},
+		{"missing signature", nil, true},
+		{"malformed signature", []byte("sha256=not-hex"), true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := verifyWebhookSignature(tc.sig, body, secret)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("verifyWebhookSignature() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}